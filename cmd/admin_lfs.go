@@ -0,0 +1,85 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/urfave/cli"
+)
+
+// CmdAdminLFS represents the `gitea admin lfs` sub-command group.
+var CmdAdminLFS = cli.Command{
+	Name:  "lfs",
+	Usage: "Manage LFS settings",
+	Subcommands: []cli.Command{
+		subcmdLFSRotateJWT,
+	},
+}
+
+var subcmdLFSRotateJWT = cli.Command{
+	Name:  "rotate-jwt",
+	Usage: "Generate a new LFS JWT signing key and append it to the keyring",
+	Description: `Adds a fresh signing key as a [lfs.jwt.<kid>] section, making it the one
+used to sign new tokens, while every previously-added key keeps verifying
+until it is retired. This allows rotating the secret without invalidating
+LFS transfers already in flight.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "config, c",
+			Value: "custom/conf/app.ini",
+			Usage: "Custom configuration file path",
+		},
+		cli.BoolFlag{
+			Name:  "retire-old",
+			Usage: "Drop every key except the newly generated one once LFS.HTTPAuthExpiry has elapsed since the last rotation",
+		},
+	},
+	Action: runLFSRotateJWT,
+}
+
+func runLFSRotateJWT(c *cli.Context) error {
+	if c.IsSet("config") {
+		setting.CustomConf = c.String("config")
+	}
+	setting.NewContext()
+
+	kid, secret, err := generateLFSJWTKey()
+	if err != nil {
+		return fmt.Errorf("Failed to generate LFS JWT key: %v", err)
+	}
+
+	setting.LFS.AppendJWTSecret(kid, secret)
+	if c.Bool("retire-old") && !setting.LFS.RetireExpired() {
+		fmt.Println("Not retiring old keys yet: LFS.HTTPAuthExpiry has not elapsed since the last rotation")
+	}
+
+	if err := setting.SaveConfig(); err != nil {
+		return fmt.Errorf("Failed to save configuration: %v", err)
+	}
+
+	fmt.Printf("Added LFS JWT signing key %q\n", kid)
+	return nil
+}
+
+// generateLFSJWTKey returns a random kid/secret pair for a new keyring
+// entry. The kid only needs to be unique within the keyring, not secret.
+func generateLFSJWTKey() (kid, secret string, err error) {
+	kidBytes := make([]byte, 4)
+	if _, err = rand.Read(kidBytes); err != nil {
+		return "", "", err
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err = rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	return hex.EncodeToString(kidBytes), hex.EncodeToString(secretBytes), nil
+}
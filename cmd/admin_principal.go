@@ -0,0 +1,72 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"fmt"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"github.com/urfave/cli"
+)
+
+// CmdAdminSSH represents the `gitea admin ssh` sub-command group.
+var CmdAdminSSH = cli.Command{
+	Name:  "ssh",
+	Usage: "Manage SSH certificate authentication",
+	Subcommands: []cli.Command{
+		subcmdSSHAddPrincipal,
+	},
+}
+
+var subcmdSSHAddPrincipal = cli.Command{
+	Name:  "add-principal",
+	Usage: "Map a certificate principal to a user",
+	Description: `Records an explicit principal -> user mapping for certificate-based SSH
+authentication, used when the certificate principal does not match the
+user's name or email directly (e.g. a service account alias).`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "config, c",
+			Value: "custom/conf/app.ini",
+			Usage: "Custom configuration file path",
+		},
+		cli.StringFlag{
+			Name:  "username",
+			Usage: "Gitea username the principal should authenticate as",
+		},
+		cli.StringFlag{
+			Name:  "principal",
+			Usage: "Certificate principal asserted by the trusted CA",
+		},
+	},
+	Action: runSSHAddPrincipal,
+}
+
+func runSSHAddPrincipal(c *cli.Context) error {
+	if c.IsSet("config") {
+		setting.CustomConf = c.String("config")
+	}
+	setting.NewContext()
+
+	username := c.String("username")
+	principal := c.String("principal")
+	if len(username) == 0 || len(principal) == 0 {
+		return fmt.Errorf("both --username and --principal are required")
+	}
+
+	user, err := models.GetUserByName(username)
+	if err != nil {
+		return fmt.Errorf("Failed to find user %q: %v", username, err)
+	}
+
+	if err := models.AddSSHPrincipal(user.ID, principal); err != nil {
+		return fmt.Errorf("Failed to add principal mapping: %v", err)
+	}
+
+	fmt.Printf("Mapped principal %q to user %q\n", principal, username)
+	return nil
+}
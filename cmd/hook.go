@@ -0,0 +1,97 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/policy"
+	"code.gitea.io/gitea/modules/private"
+
+	"github.com/Unknwon/com"
+	"github.com/urfave/cli"
+)
+
+// CmdHook represents the `gitea hook` sub-command group. These are never
+// invoked directly by a user: they are what the shims Gitea writes into a
+// repository's .git/hooks/ call out to, for both the SSH (cmd/serv) and
+// HTTP push paths - git always runs a repository's hooks the same way
+// regardless of which transport delivered the push.
+var CmdHook = cli.Command{
+	Name:   "hook",
+	Usage:  "Delegate Git hooks to Gitea",
+	Hidden: true,
+	Subcommands: []cli.Command{
+		subcmdHookPreReceive,
+	},
+}
+
+var subcmdHookPreReceive = cli.Command{
+	Name:   "pre-receive",
+	Usage:  "Gitea's internal pre-receive hook",
+	Action: runHookPreReceive,
+}
+
+// runHookPreReceive implements the git pre-receive hook contract: one
+// "<old-sha> <new-sha> <ref>" line per updated ref on stdin, run after the
+// incoming pack has been indexed but before any ref is updated. Exiting
+// non-zero aborts the entire push and relays stderr to the client, so
+// unlike inspecting the raw pack stream ourselves this can never race
+// git-receive-pack's own ref update.
+func runHookPreReceive(c *cli.Context) error {
+	setup("hooks.log")
+
+	repoID := com.StrTo(os.Getenv(models.ProtectedBranchRepoID)).MustInt64()
+	if repoID == 0 {
+		// Not invoked by gitea serv/the HTTP handler (e.g. run by hand);
+		// nothing to enforce.
+		return nil
+	}
+
+	repoPolicy, err := private.GetRepoPolicy(repoID)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to load repo policy: %v", err), 1)
+	}
+	if repoPolicy.IsEmpty() {
+		return nil
+	}
+
+	repoPath, err := os.Getwd()
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to determine repository path: %v", err), 1)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		oldSHA, newSHA, ref := fields[0], fields[1], fields[2]
+		if policy.IsEmptyObjectID(newSHA) {
+			// Branch deletion: nothing new was introduced to check.
+			continue
+		}
+
+		commits, err := policy.LoadPushedCommits(repoPath, oldSHA, newSHA)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to inspect %s: %v", ref, err), 1)
+		}
+
+		if err := policy.Check(repoPolicy, commits); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return cli.NewExitError("", 1)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to read ref updates: %v", err), 1)
+	}
+
+	return nil
+}
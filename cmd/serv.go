@@ -8,6 +8,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/audit"
 	"code.gitea.io/gitea/modules/log"
 	"code.gitea.io/gitea/modules/pprof"
 	"code.gitea.io/gitea/modules/private"
@@ -45,6 +47,10 @@ var CmdServ = cli.Command{
 		cli.BoolFlag{
 			Name: "enable-pprof",
 		},
+		cli.StringFlag{
+			Name:  "principal",
+			Usage: "SSH certificate principal, set by sshd's AuthorizedPrincipalsCommand",
+		},
 	},
 }
 
@@ -53,6 +59,28 @@ func setup(logPath string) {
 	log.NewGitLogger(filepath.Join(setting.LogRootPath, logPath))
 }
 
+// principalFromRequest returns the SSH certificate principal for this
+// connection, if any. sshd passes it via the --principal flag, driven by
+// an AuthorizedPrincipalsCommand that has already checked the certificate
+// against its own (sshd_config) TrustedUserCAKeys; a plain public key
+// connection has none and falls back to the existing key-<id> lookup.
+//
+// This forced-command path cannot independently re-verify the certificate
+// itself (CA signature, ValidBefore/ValidAfter, critical options): sshd
+// never hands the raw certificate to the command it execs, only this
+// principal string. Verification against setting.SSH.TrustedUserCAKeys is
+// only possible where Gitea terminates the SSH protocol itself, in its own
+// built-in SSH server (StartBuiltinServer), through
+// modules/ssh.NewCertChecker; this build's built-in server does not call
+// NewCertChecker, so Gitea does not verify certificates there either.
+//
+// SSH_USER_AUTH (enabled by sshd's ExposeAuthInfo) is deliberately not
+// used here: it names a file of auth-method log lines, not a principal, and
+// treating its value as one would silently fail to resolve any user.
+func principalFromRequest(c *cli.Context) string {
+	return c.String("principal")
+}
+
 func parseCmd(cmd string) (string, string) {
 	ss := strings.SplitN(cmd, " ", 2)
 	if len(ss) != 2 {
@@ -70,17 +98,57 @@ var (
 	}
 )
 
+// servAudit and servAuditStart hold the in-flight audit event for this
+// `gitea serv` invocation, servSlot the concurrency slot (if any) it has
+// acquired, and servBytesIn/servBytesOut the counting wrappers placed around
+// git's stdin/stdout once the git process is spawned. A process only ever
+// handles one request, so package-level state (rather than threading it
+// through every function signature, including the many early-exit paths
+// through fail()) is sufficient here.
+var (
+	servAudit      = &audit.Event{Event: "ssh.git"}
+	servAuditStart time.Time
+	servSlot       *private.ServSlot
+	servBytesIn    *countingReader
+	servBytesOut   *countingWriter
+)
+
+// auditResult finalizes and emits servAudit with the given result/reason,
+// called from both the success path and every fail() exit. It reads
+// servBytesIn/servBytesOut at emit time rather than relying on a single
+// assignment on the success path, so a failure partway through git's
+// execution still reports the bytes actually transferred so far.
+func auditResult(result, reason string) {
+	if servBytesIn != nil {
+		servAudit.BytesIn = servBytesIn.n
+	}
+	if servBytesOut != nil {
+		servAudit.BytesOut = servBytesOut.n
+	}
+	servAudit.Result = result
+	servAudit.Reason = reason
+	servAudit.Duration = time.Since(servAuditStart)
+	audit.Log(*servAudit)
+}
+
 func fail(userMessage, logMessage string, args ...interface{}) {
 	fmt.Fprintln(os.Stderr, "Gitea:", userMessage)
 
+	// fail exits the process directly (Fatal/os.Exit below), so deferred
+	// calls never run: release any acquired slot here instead of relying on
+	// defer.
+	servSlot.Release()
+
 	if len(logMessage) > 0 {
 		if !setting.ProdMode {
 			fmt.Fprintf(os.Stderr, logMessage+"\n", args...)
 		}
+		auditResult("denied", fmt.Sprintf(logMessage, args...))
 		log.GitLogger.Fatal(3, logMessage, args...)
 		return
 	}
 
+	auditResult("denied", userMessage)
 	log.GitLogger.Close()
 	os.Exit(1)
 }
@@ -91,6 +159,10 @@ func runServ(c *cli.Context) error {
 	}
 	setup("serv.log")
 
+	servAuditStart = time.Now()
+	servAudit.Time = servAuditStart
+	servAudit.RemoteIP = remoteIPFromEnv()
+
 	if setting.SSH.Disabled {
 		println("Gitea: SSH has been disabled")
 		return nil
@@ -109,6 +181,7 @@ func runServ(c *cli.Context) error {
 	}
 
 	verb, args := parseCmd(cmd)
+	servAudit.Verb = verb
 
 	var lfsVerb string
 	if verb == lfsAuthenticateVerb {
@@ -131,6 +204,8 @@ func runServ(c *cli.Context) error {
 
 	username := strings.ToLower(rr[0])
 	reponame := strings.ToLower(strings.TrimSuffix(rr[1], ".git"))
+	servAudit.Repo = username + "/" + reponame
+	servAudit.LFSVerb = lfsVerb
 
 	if setting.EnablePprof || c.Bool("enable-pprof") {
 		if err := os.MkdirAll(setting.PprofDataPath, os.ModePerm); err != nil {
@@ -183,6 +258,8 @@ func runServ(c *cli.Context) error {
 		}
 	}
 
+	servAudit.AccessMode = requestedMode.String()
+
 	// Prohibit push to mirror repositories.
 	if requestedMode > models.AccessModeRead && repo.IsMirror {
 		fail("mirror repository is read-only", "")
@@ -194,41 +271,64 @@ func runServ(c *cli.Context) error {
 		user  *models.User
 	)
 	if requestedMode == models.AccessModeWrite || repo.IsPrivate || setting.Service.RequireSignInView {
-		keys := strings.Split(c.Args()[0], "-")
-		if len(keys) != 2 {
-			fail("Key ID format error", "Invalid key argument: %s", c.Args()[0])
-		}
-
-		key, err := private.GetPublicKeyByID(com.StrTo(keys[1]).MustInt64())
-		if err != nil {
-			fail("Invalid key ID", "Invalid key ID[%s]: %v", c.Args()[0], err)
-		}
-		keyID = key.ID
-
-		// Check deploy key or user key.
-		if key.Type == models.KeyTypeDeploy {
-			if key.Mode < requestedMode {
-				fail("Key permission denied", "Cannot push with deployment key: %d", key.ID)
-			}
-
-			// Check if this deploy key belongs to current repository.
-			has, err := private.HasDeployKey(key.ID, repo.ID)
+		principal := principalFromRequest(c)
+		if len(principal) > 0 && setting.SSH.CertificateAuthEnabled {
+			// Certificate-authenticated connection: sshd has already verified
+			// the signature against its own TrustedUserCAKeys and validity
+			// window before ever invoking us, so we only need to resolve the
+			// principal to a Gitea user and run the usual access-mode check.
+			// Gitea itself never sees the certificate here and performs no
+			// CA/validity checks of its own - see principalFromRequest.
+			user, err = private.GetUserByPrincipal(principal)
 			if err != nil {
-				fail("Key access denied", "Failed to access internal api: [key_id: %d, repo_id: %d]", key.ID, repo.ID)
+				fail("Invalid certificate principal", "Failed to resolve certificate principal %q: %v", principal, err)
 			}
-			if !has {
-				fail("Key access denied", "Deploy key access denied: [key_id: %d, repo_id: %d]", key.ID, repo.ID)
+		} else {
+			keys := strings.Split(c.Args()[0], "-")
+			if len(keys) != 2 {
+				fail("Key ID format error", "Invalid key argument: %s", c.Args()[0])
 			}
 
-			// Update deploy key activity.
-			if err = private.UpdateDeployKeyUpdated(key.ID, repo.ID); err != nil {
-				fail("Internal error", "UpdateDeployKey: %v", err)
-			}
-		} else {
-			user, err = private.GetUserByKeyID(key.ID)
+			key, err := private.GetPublicKeyByID(com.StrTo(keys[1]).MustInt64())
 			if err != nil {
-				fail("internal error", "Failed to get user by key ID(%d): %v", keyID, err)
+				fail("Invalid key ID", "Invalid key ID[%s]: %v", c.Args()[0], err)
+			}
+			keyID = key.ID
+			servAudit.KeyID = key.ID
+			servAudit.KeyFingerprint = key.Fingerprint
+
+			// Check deploy key or user key.
+			if key.Type == models.KeyTypeDeploy {
+				if key.Mode < requestedMode {
+					fail("Key permission denied", "Cannot push with deployment key: %d", key.ID)
+				}
+
+				// Check if this deploy key belongs to current repository.
+				has, err := private.HasDeployKey(key.ID, repo.ID)
+				if err != nil {
+					fail("Key access denied", "Failed to access internal api: [key_id: %d, repo_id: %d]", key.ID, repo.ID)
+				}
+				if !has {
+					fail("Key access denied", "Deploy key access denied: [key_id: %d, repo_id: %d]", key.ID, repo.ID)
+				}
+
+				// Update deploy key activity.
+				if err = private.UpdateDeployKeyUpdated(key.ID, repo.ID); err != nil {
+					fail("Internal error", "UpdateDeployKey: %v", err)
+				}
+			} else {
+				user, err = private.GetUserByKeyID(key.ID)
+				if err != nil {
+					fail("internal error", "Failed to get user by key ID(%d): %v", keyID, err)
+				}
 			}
+		}
+
+		// User key, deploy key, or certificate principal all converge here
+		// for the shared access-mode check (deploy keys are checked above
+		// and have no associated user).
+		if user != nil {
+			servAudit.User = user.Name
 
 			if !user.IsActive || user.ProhibitLogin {
 				fail("Your account is not active or has been disabled by Administrator",
@@ -270,8 +370,17 @@ func runServ(c *cli.Context) error {
 		}
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
+		// Tag the token with the signing key's kid so the LFS HTTP verifier
+		// can pick the right key out of the keyring without trying every
+		// active and retired secret in turn.
+		signingKey, err := setting.LFS.SigningKey()
+		if err != nil {
+			fail("Internal error", "Failed to get LFS JWT signing key: %v", err)
+		}
+		token.Header["kid"] = signingKey.Kid
+
 		// Sign and get the complete encoded token as a string using the secret
-		tokenString, err := token.SignedString(setting.LFS.JWTSecretBytes)
+		tokenString, err := token.SignedString([]byte(signingKey.Secret))
 		if err != nil {
 			fail("Internal error", "Failed to sign JWT token: %v", err)
 		}
@@ -288,9 +397,31 @@ func runServ(c *cli.Context) error {
 			fail("Internal error", "Failed to encode LFS json response: %v", err)
 		}
 
+		auditResult("granted", "")
 		return nil
 	}
 
+	// Enforce [ssh.limits]: cap how many git processes this key/user may
+	// run concurrently and how often, shared across every SSH connection
+	// on the node via the web process. Anonymous clones (no key, no user -
+	// e.g. a public repo with RequireSignInView off) have no real identity
+	// to key the bucket on, so they are left unlimited rather than pooling
+	// every anonymous client on the instance into one shared (0,0) bucket.
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	if (keyID > 0 || userID > 0) && (setting.SSH.Limits.MaxConcurrentPerKey > 0 || setting.SSH.Limits.ClonesPerMinute > 0 || setting.SSH.Limits.PushesPerMinute > 0) {
+		slot, err := private.AcquireServSlot(keyID, userID, verb)
+		if err != nil {
+			fail("Too many concurrent or recent git operations for this key", "AcquireServSlot: %v", err)
+		}
+		// Stored package-level rather than deferred: every error path below
+		// this point exits via fail(), which bypasses defers but explicitly
+		// releases servSlot itself.
+		servSlot = slot
+	}
+
 	// Special handle for Windows.
 	if setting.IsWindows {
 		verb = strings.Replace(verb, "-", " ", 1)
@@ -312,9 +443,18 @@ func runServ(c *cli.Context) error {
 	os.Setenv(models.ProtectedBranchRepoID, fmt.Sprintf("%d", repo.ID))
 
 	gitcmd.Dir = setting.RepoRootPath
-	gitcmd.Stdout = os.Stdout
-	gitcmd.Stdin = os.Stdin
+	servBytesIn = &countingReader{r: os.Stdin}
+	servBytesOut = &countingWriter{w: os.Stdout}
+	gitcmd.Stdout = servBytesOut
+	gitcmd.Stdin = servBytesIn
 	gitcmd.Stderr = os.Stderr
+
+	// Repository-level push policy (max file/push size, forbidden paths,
+	// required signed commits, ...) is enforced by the pre-receive hook
+	// installed for this repository (see cmd/hook.go): git runs it after
+	// indexing the incoming pack but before updating any ref, so a
+	// rejection there aborts the push atomically for both this SSH path
+	// and the HTTP push path, without racing git-receive-pack here.
 	if err = gitcmd.Run(); err != nil {
 		fail("Internal error", "Failed to execute git command: %v", err)
 	}
@@ -326,5 +466,42 @@ func runServ(c *cli.Context) error {
 		}
 	}
 
+	servSlot.Release()
+	auditResult("granted", "")
+
 	return nil
 }
+
+// countingReader and countingWriter wrap stdin/stdout so the audit event
+// can report how much data actually crossed the wire for this operation.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// remoteIPFromEnv extracts the client IP from SSH_CONNECTION, which sshd
+// sets to "client-ip client-port server-ip server-port".
+func remoteIPFromEnv() string {
+	fields := strings.Fields(os.Getenv("SSH_CONNECTION"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,38 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"github.com/go-xorm/xorm"
+)
+
+// This file must be registered in the `migrations` slice in
+// models/migrations/migrations.go (not present in this tree) for Sync2 to
+// ever run against a real database - see the NewMigration call other
+// entries in that slice use.
+
+// addRepoPolicyTable creates the table behind models.RepoPolicy (chunk0-2's
+// pre-receive policy engine). The struct is redeclared here, not imported
+// from models, because migrations must describe the schema as it existed
+// at the time they were written, independent of later changes to the live
+// model.
+func addRepoPolicyTable(x *xorm.Engine) error {
+	type RepoPolicy struct {
+		ID     int64 `xorm:"pk autoincr"`
+		RepoID int64 `xorm:"UNIQUE NOT NULL"`
+
+		MaxFileSize          int64  `xorm:"DEFAULT 0"`
+		MaxPushSize          int64  `xorm:"DEFAULT 0"`
+		ForbiddenPaths       string `xorm:"TEXT"`
+		RequireSignedCommits bool
+		RequireSignedOffBy   bool
+		CommitMessageRegex   string `xorm:"VARCHAR(255)"`
+
+		CreatedUnix int64 `xorm:"INDEX created"`
+		UpdatedUnix int64 `xorm:"INDEX updated"`
+	}
+
+	return x.Sync2(new(RepoPolicy))
+}
@@ -0,0 +1,32 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package migrations
+
+import (
+	"github.com/go-xorm/xorm"
+)
+
+// This file must be registered in the `migrations` slice in
+// models/migrations/migrations.go (not present in this tree) for Sync2 to
+// ever run against a real database - see the NewMigration call other
+// entries in that slice use.
+
+// addSSHPrincipalTable creates the table behind models.SSHPrincipal
+// (chunk0-1's certificate-principal-to-user mapping). The struct is
+// redeclared here, not imported from models, because migrations must
+// describe the schema as it existed at the time they were written,
+// independent of later changes to the live model.
+func addSSHPrincipalTable(x *xorm.Engine) error {
+	type SSHPrincipal struct {
+		ID        int64  `xorm:"pk autoincr"`
+		UserID    int64  `xorm:"INDEX NOT NULL"`
+		Principal string `xorm:"UNIQUE NOT NULL"`
+
+		CreatedUnix int64 `xorm:"INDEX created"`
+		UpdatedUnix int64 `xorm:"INDEX updated"`
+	}
+
+	return x.Sync2(new(SSHPrincipal))
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+// RepoPolicy holds the declarative push rules for a repository, evaluated
+// by the policy engine before a push is accepted. A zero value disables
+// every check.
+type RepoPolicy struct {
+	ID     int64 `xorm:"pk autoincr"`
+	RepoID int64 `xorm:"UNIQUE NOT NULL"`
+
+	MaxFileSize          int64  `xorm:"DEFAULT 0"` // bytes, 0 means unlimited
+	MaxPushSize          int64  `xorm:"DEFAULT 0"` // bytes, 0 means unlimited
+	ForbiddenPaths       string `xorm:"TEXT"`      // newline separated globs
+	RequireSignedCommits bool
+	RequireSignedOffBy   bool
+	CommitMessageRegex   string `xorm:"VARCHAR(255)"`
+
+	CreatedUnix int64 `xorm:"INDEX created"`
+	UpdatedUnix int64 `xorm:"INDEX updated"`
+}
+
+// GetRepoPolicy returns the policy configured for a repository, or nil if
+// none has been set (in which case no rules are enforced).
+func GetRepoPolicy(repoID int64) (*RepoPolicy, error) {
+	policy := &RepoPolicy{RepoID: repoID}
+	has, err := x.Get(policy)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// IsEmpty reports whether the policy enforces no rules at all, letting
+// callers skip walking the pushed commits entirely.
+func (p *RepoPolicy) IsEmpty() bool {
+	return p == nil || (p.MaxFileSize == 0 && p.MaxPushSize == 0 &&
+		len(p.ForbiddenPaths) == 0 && !p.RequireSignedCommits &&
+		!p.RequireSignedOffBy && len(p.CommitMessageRegex) == 0)
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SSHPrincipal maps an SSH certificate principal (as asserted by a trusted
+// CA) to the Gitea user it authenticates. Unlike PublicKey, no key material
+// is stored here: trust is derived entirely from the signing CA.
+type SSHPrincipal struct {
+	ID        int64  `xorm:"pk autoincr"`
+	UserID    int64  `xorm:"INDEX NOT NULL"`
+	Principal string `xorm:"UNIQUE NOT NULL"`
+
+	CreatedUnix int64 `xorm:"INDEX created"`
+	UpdatedUnix int64 `xorm:"INDEX updated"`
+}
+
+// GetUserByPrincipal looks up the user matching an SSH certificate
+// principal. Principals are matched against an explicit mapping first
+// (SSHPrincipal), falling back to a direct match against the user's name or
+// primary email depending on format.
+func GetUserByPrincipal(principal, format string) (*User, error) {
+	principal = strings.ToLower(strings.TrimSpace(principal))
+	if len(principal) == 0 {
+		return nil, fmt.Errorf("empty principal")
+	}
+
+	mapping := new(SSHPrincipal)
+	has, err := x.Where("principal = ?", principal).Get(mapping)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return GetUserByID(mapping.UserID)
+	}
+
+	switch format {
+	case "email":
+		return GetUserByEmail(principal)
+	default:
+		return GetUserByName(principal)
+	}
+}
+
+// AddSSHPrincipal records an explicit principal -> user mapping, used when
+// the certificate principal does not match the user's name or email
+// directly (e.g. a service account alias).
+func AddSSHPrincipal(userID int64, principal string) error {
+	principal = strings.ToLower(strings.TrimSpace(principal))
+	if len(principal) == 0 {
+		return fmt.Errorf("empty principal")
+	}
+
+	_, err := x.Insert(&SSHPrincipal{
+		UserID:    userID,
+		Principal: principal,
+	})
+	return err
+}
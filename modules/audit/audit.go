@@ -0,0 +1,56 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package audit emits structured, machine-readable events for git
+// operations (currently SSH, via cmd/serv) so admins get a real compliance
+// trail instead of grepping serv.log, and SIEM tools can ingest Gitea
+// events directly.
+package audit
+
+import (
+	"time"
+
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// Event describes a single git operation, from request to completion.
+type Event struct {
+	Time           time.Time     `json:"time"`
+	Event          string        `json:"event"` // e.g. "ssh.git"
+	User           string        `json:"user,omitempty"`
+	KeyID          int64         `json:"key_id,omitempty"`
+	KeyFingerprint string        `json:"key_fingerprint,omitempty"`
+	Repo           string        `json:"repo"`
+	Verb           string        `json:"verb"`
+	LFSVerb        string        `json:"lfs_verb,omitempty"`
+	AccessMode     string        `json:"access_mode"`
+	Result         string        `json:"result"` // "granted", "denied" or "error"
+	Reason         string        `json:"reason,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	BytesIn        int64         `json:"bytes_in"`
+	BytesOut       int64         `json:"bytes_out"`
+	RemoteIP       string        `json:"remote_ip,omitempty"`
+}
+
+// Log emits e to the sink configured under [audit]. Failures to emit are
+// logged with log.Error but never block or fail the calling git operation.
+func Log(e Event) {
+	if !setting.Audit.Enabled {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	sink, err := currentSink()
+	if err != nil {
+		log.Error(4, "audit: failed to open sink: %v", err)
+		return
+	}
+
+	if err := sink.Write(e); err != nil {
+		log.Error(4, "audit: failed to write event: %v", err)
+	}
+}
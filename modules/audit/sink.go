@@ -0,0 +1,135 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.gitea.io/gitea/modules/log"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// Sink persists a single audit Event.
+type Sink interface {
+	Write(e Event) error
+}
+
+func currentSink() (Sink, error) {
+	switch setting.Audit.Sink {
+	case "syslog":
+		return newSyslogSink()
+	case "webhook":
+		return &webhookSink{url: setting.Audit.WebhookURL, timeout: time.Duration(setting.Audit.WebhookTimeout) * time.Second}, nil
+	default:
+		return newFileSink(setting.Audit.FilePath)
+	}
+}
+
+type fileSink struct {
+	path string
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &fileSink{path: path}, nil
+}
+
+func (s *fileSink) Write(e Event) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	return enc.Encode(e)
+}
+
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink() (*syslogSink, error) {
+	w, err := syslog.Dial(setting.Audit.SyslogNetwork, setting.Audit.SyslogAddress, syslog.LOG_INFO|syslog.LOG_AUTH, "gitea")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: w}, nil
+}
+
+func (s *syslogSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.writer.Info(string(b))
+}
+
+type webhookSink struct {
+	url     string
+	timeout time.Duration
+}
+
+// webhookQueue decouples Write from the actual POST: Log is called inline
+// on every SSH git operation (cmd/serv's auditResult), so a slow or
+// unresponsive webhook endpoint must never add its latency to every clone
+// and push. A single worker (started by webhookOnce) drains it in the
+// background; queue capacity bounds memory if the endpoint is down rather
+// than blocking the calling git operation.
+var (
+	webhookQueue = make(chan Event, 1000)
+	webhookOnce  sync.Once
+)
+
+func (s *webhookSink) Write(e Event) error {
+	webhookOnce.Do(func() { go s.deliver() })
+
+	select {
+	case webhookQueue <- e:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue is full, dropping event")
+	}
+}
+
+// deliver runs for the lifetime of the process, posting queued events to
+// the webhook one at a time. Failures are logged, not returned: by the
+// time a delivery fails, Write has already reported success to its caller.
+func (s *webhookSink) deliver() {
+	client := &http.Client{Timeout: s.timeout}
+	for e := range webhookQueue {
+		if err := s.post(client, e); err != nil {
+			log.Error(4, "audit: failed to post event to webhook: %v", err)
+		}
+	}
+}
+
+func (s *webhookSink) post(client *http.Client, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
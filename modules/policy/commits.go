@@ -0,0 +1,186 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// emptyObjectID is the all-zero object ID git uses to mean "ref does not
+// exist", e.g. as the old-SHA of a pre-receive line creating a new branch.
+// Kept private to this package: modules/git already defines its own
+// (unrelated-signature) EmptySHA/Commit for repository history, and this
+// package's pushed-commit walk has no business reusing those identifiers.
+const emptyObjectID = "0000000000000000000000000000000000000000"
+
+// ChangedFile is one file touched by a PushedCommit, as reported by `git
+// diff-tree`.
+type ChangedFile struct {
+	Path    string
+	Size    int64
+	Deleted bool
+}
+
+// PushedCommit is a single commit introduced by a ref update, with just
+// enough detail for Check to evaluate its rules without re-implementing
+// pack/delta decoding: by the time a pre-receive hook runs, git has already
+// indexed the incoming objects into the repository (or its quarantine
+// directory), so plain plumbing commands see them like any other commit.
+type PushedCommit struct {
+	SHA      string
+	Message  string
+	Signed   bool
+	Trailers []string
+	Files    []ChangedFile
+}
+
+// LoadPushedCommits returns, oldest first, every commit a ref update from
+// oldSHA to newSHA introduces. oldSHA may be the empty object ID (a new
+// branch), in which case the range is newSHA reachable from no existing
+// ref: the commits this push actually adds to the repository, not every
+// commit reachable from newSHA (which for a branch created off existing
+// history would re-walk and re-check years of already-accepted commits on
+// every push).
+func LoadPushedCommits(repoPath, oldSHA, newSHA string) ([]PushedCommit, error) {
+	var args []string
+	if oldSHA == emptyObjectID {
+		args = []string{"rev-list", "--reverse", newSHA, "--not", "--all"}
+	} else {
+		args = []string{"rev-list", "--reverse", oldSHA + ".." + newSHA}
+	}
+
+	out, err := gitOutput(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("rev-list %s: %v", strings.Join(args[1:], " "), err)
+	}
+
+	shas := strings.Fields(out)
+	commits := make([]PushedCommit, 0, len(shas))
+	for _, sha := range shas {
+		c, err := inspectCommit(repoPath, sha)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// IsEmptyObjectID reports whether sha is the all-zero object ID a
+// pre-receive line uses to mean "ref does not exist".
+func IsEmptyObjectID(sha string) bool {
+	return sha == emptyObjectID
+}
+
+func inspectCommit(repoPath, sha string) (PushedCommit, error) {
+	message, err := gitOutput(repoPath, "show", "-s", "--format=%B", sha)
+	if err != nil {
+		return PushedCommit{}, fmt.Errorf("show %s: %v", sha, err)
+	}
+
+	signature, err := gitOutput(repoPath, "show", "-s", "--format=%G?", sha)
+	if err != nil {
+		return PushedCommit{}, fmt.Errorf("show %s: %v", sha, err)
+	}
+
+	files, err := changedFiles(repoPath, sha)
+	if err != nil {
+		return PushedCommit{}, err
+	}
+
+	return PushedCommit{
+		SHA:      sha,
+		Message:  message,
+		Signed:   strings.TrimSpace(signature) == "G",
+		Trailers: trailerLines(message),
+		Files:    files,
+	}, nil
+}
+
+// changedFiles reports every path touched by sha, including deletions
+// (tagged via ChangedFile.Deleted) so Check can apply MaxFileSize and
+// ForbiddenPaths only to paths the push actually adds or modifies, not to
+// paths it removes.
+func changedFiles(repoPath, sha string) ([]ChangedFile, error) {
+	out, err := gitOutput(repoPath, "diff-tree", "--no-commit-id", "--name-status", "-r", sha)
+	if err != nil {
+		return nil, fmt.Errorf("diff-tree %s: %v", sha, err)
+	}
+
+	var files []ChangedFile
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		status, path := fields[0], fields[1]
+		deleted := strings.HasPrefix(status, "D")
+
+		var size int64
+		if !deleted {
+			size, err = blobSize(repoPath, sha, path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, ChangedFile{Path: path, Size: size, Deleted: deleted})
+	}
+	return files, nil
+}
+
+// blobSize returns the size of path as it exists at sha. A path that was
+// deleted in this commit (cat-file fails to resolve it) is reported as size
+// 0: a policy engine evaluating file sizes has nothing to check for a file
+// that is no longer there.
+func blobSize(repoPath, sha, path string) (int64, error) {
+	out, err := gitOutput(repoPath, "cat-file", "-s", sha+":"+path)
+	if err != nil {
+		return 0, nil
+	}
+
+	var size int64
+	if _, err := fmt.Sscanf(strings.TrimSpace(out), "%d", &size); err != nil {
+		return 0, fmt.Errorf("unexpected cat-file -s output %q: %v", out, err)
+	}
+	return size, nil
+}
+
+// trailerLines returns the trailer block of a commit message (e.g.
+// "Signed-off-by: ..."), parsed the same way git itself does so policy
+// checks agree with what `git interpret-trailers` would report.
+func trailerLines(message string) []string {
+	cmd := exec.Command("git", "interpret-trailers", "--only-trailers")
+	cmd.Stdin = strings.NewReader(message)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+
+	trimmed := strings.TrimSpace(out.String())
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "\n")
+}
+
+func gitOutput(repoPath string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
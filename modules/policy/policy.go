@@ -0,0 +1,103 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package policy enforces declarative, repository-level push rules
+// (RepoPolicy) against the commits a ref update introduces. It is invoked
+// from cmd/hook's pre-receive hook, which git runs for every push -
+// SSH or HTTP - after the incoming objects are indexed but before any ref
+// is updated, so a rejection here always aborts the push atomically.
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"code.gitea.io/gitea/models"
+)
+
+// Violation is returned when a push is rejected by the policy engine. Its
+// Error() message is safe to relay to the client over the git sideband.
+type Violation struct {
+	Rule   string
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("policy violation (%s): %s", v.Rule, v.Detail)
+}
+
+// Check evaluates policy against commits, returning the first Violation
+// encountered. A nil policy (or one with IsEmpty() true) always passes.
+func Check(repoPolicy *models.RepoPolicy, commits []PushedCommit) error {
+	if repoPolicy.IsEmpty() {
+		return nil
+	}
+
+	var forbidden []string
+	if len(repoPolicy.ForbiddenPaths) > 0 {
+		forbidden = strings.Split(repoPolicy.ForbiddenPaths, "\n")
+	}
+
+	var msgRe *regexp.Regexp
+	if len(repoPolicy.CommitMessageRegex) > 0 {
+		re, err := regexp.Compile(repoPolicy.CommitMessageRegex)
+		if err != nil {
+			return fmt.Errorf("invalid CommitMessageRegex: %v", err)
+		}
+		msgRe = re
+	}
+
+	var pushSize int64
+	for _, commit := range commits {
+		if repoPolicy.RequireSignedCommits && !commit.Signed {
+			return &Violation{"require-signed-commits", commit.SHA}
+		}
+		if repoPolicy.RequireSignedOffBy && !hasSignedOffBy(commit.Trailers) {
+			return &Violation{"require-signed-off-by", commit.SHA}
+		}
+		if msgRe != nil && !msgRe.MatchString(commit.Message) {
+			return &Violation{"commit-message-regex", commit.SHA}
+		}
+
+		for _, f := range commit.Files {
+			if f.Deleted {
+				// Removing a file introduces nothing to check: it shouldn't
+				// count against MaxPushSize, MaxFileSize, or trip
+				// ForbiddenPaths (e.g. deleting an accidentally committed
+				// secrets/key.pem should never itself be the violation).
+				continue
+			}
+
+			pushSize += f.Size
+
+			if repoPolicy.MaxFileSize > 0 && f.Size > repoPolicy.MaxFileSize {
+				return &Violation{"max-file-size", fmt.Sprintf("%s is %d bytes, limit is %d", f.Path, f.Size, repoPolicy.MaxFileSize)}
+			}
+			for _, pattern := range forbidden {
+				if pattern == "" {
+					continue
+				}
+				if ok, _ := filepath.Match(pattern, f.Path); ok {
+					return &Violation{"forbidden-path", f.Path}
+				}
+			}
+		}
+	}
+
+	if repoPolicy.MaxPushSize > 0 && pushSize > repoPolicy.MaxPushSize {
+		return &Violation{"max-push-size", fmt.Sprintf("push is %d bytes, limit is %d", pushSize, repoPolicy.MaxPushSize)}
+	}
+	return nil
+}
+
+func hasSignedOffBy(trailers []string) bool {
+	for _, t := range trailers {
+		if strings.HasPrefix(t, "Signed-off-by:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"testing"
+
+	"code.gitea.io/gitea/models"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		repo      *models.RepoPolicy
+		commits   []PushedCommit
+		wantRule  string
+		wantError bool
+	}{
+		{
+			name:    "empty policy always passes",
+			repo:    &models.RepoPolicy{},
+			commits: []PushedCommit{{SHA: "a", Files: []ChangedFile{{Path: "big.bin", Size: 1 << 30}}}},
+		},
+		{
+			name:     "max file size violation",
+			repo:     &models.RepoPolicy{MaxFileSize: 100},
+			commits:  []PushedCommit{{SHA: "a", Files: []ChangedFile{{Path: "big.bin", Size: 200}}}},
+			wantRule: "max-file-size",
+		},
+		{
+			name:     "max push size violation across commits",
+			repo:     &models.RepoPolicy{MaxPushSize: 150},
+			commits:  []PushedCommit{{SHA: "a", Files: []ChangedFile{{Path: "a.bin", Size: 100}}}, {SHA: "b", Files: []ChangedFile{{Path: "b.bin", Size: 100}}}},
+			wantRule: "max-push-size",
+		},
+		{
+			name:     "forbidden path violation",
+			repo:     &models.RepoPolicy{ForbiddenPaths: "secrets/*"},
+			commits:  []PushedCommit{{SHA: "a", Files: []ChangedFile{{Path: "secrets/key.pem", Size: 1}}}},
+			wantRule: "forbidden-path",
+		},
+		{
+			name:    "non-matching forbidden path passes",
+			repo:    &models.RepoPolicy{ForbiddenPaths: "secrets/*"},
+			commits: []PushedCommit{{SHA: "a", Files: []ChangedFile{{Path: "src/main.go", Size: 1}}}},
+		},
+		{
+			name:    "deleting a forbidden path passes",
+			repo:    &models.RepoPolicy{ForbiddenPaths: "secrets/*", MaxFileSize: 1},
+			commits: []PushedCommit{{SHA: "a", Files: []ChangedFile{{Path: "secrets/key.pem", Size: 0, Deleted: true}}}},
+		},
+		{
+			name:     "require signed commits violation",
+			repo:     &models.RepoPolicy{RequireSignedCommits: true},
+			commits:  []PushedCommit{{SHA: "a", Signed: false}},
+			wantRule: "require-signed-commits",
+		},
+		{
+			name:    "require signed commits satisfied",
+			repo:    &models.RepoPolicy{RequireSignedCommits: true},
+			commits: []PushedCommit{{SHA: "a", Signed: true}},
+		},
+		{
+			name:     "require signed-off-by violation",
+			repo:     &models.RepoPolicy{RequireSignedOffBy: true},
+			commits:  []PushedCommit{{SHA: "a", Trailers: []string{"Reviewed-by: x"}}},
+			wantRule: "require-signed-off-by",
+		},
+		{
+			name:    "require signed-off-by satisfied",
+			repo:    &models.RepoPolicy{RequireSignedOffBy: true},
+			commits: []PushedCommit{{SHA: "a", Trailers: []string{"Signed-off-by: x"}}},
+		},
+		{
+			name:     "commit message regex violation",
+			repo:     &models.RepoPolicy{CommitMessageRegex: `^JIRA-\d+`},
+			commits:  []PushedCommit{{SHA: "a", Message: "no ticket here"}},
+			wantRule: "commit-message-regex",
+		},
+		{
+			name:    "commit message regex satisfied",
+			repo:    &models.RepoPolicy{CommitMessageRegex: `^JIRA-\d+`},
+			commits: []PushedCommit{{SHA: "a", Message: "JIRA-42 fix thing"}},
+		},
+		{
+			name:      "invalid commit message regex errors",
+			repo:      &models.RepoPolicy{CommitMessageRegex: `(`},
+			commits:   []PushedCommit{{SHA: "a"}},
+			wantError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Check(c.repo, c.commits)
+			if c.wantRule == "" && !c.wantError {
+				if err != nil {
+					t.Fatalf("expected no violation, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if c.wantError {
+				if _, ok := err.(*Violation); ok {
+					t.Fatalf("expected a plain error, got a Violation: %v", err)
+				}
+				return
+			}
+			v, ok := err.(*Violation)
+			if !ok {
+				t.Fatalf("expected a *Violation, got %T: %v", err, err)
+			}
+			if v.Rule != c.wantRule {
+				t.Fatalf("expected rule %q, got %q", c.wantRule, v.Rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package private
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// GetRepoPolicy calls the internal API to fetch the push policy configured
+// for a repository. A nil result means the repository has no policy and no
+// rules should be enforced.
+func GetRepoPolicy(repoID int64) (*models.RepoPolicy, error) {
+	reqURL := setting.LocalURL + fmt.Sprintf("api/internal/repositories/%d/policy", repoID)
+
+	resp, err := newInternalRequest(reqURL, "GET").Response()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Failed to get repo policy(%d): %s", repoID, decodeJSONError(resp).Err)
+	}
+
+	var policy models.RepoPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
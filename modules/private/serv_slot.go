@@ -0,0 +1,71 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package private
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"code.gitea.io/gitea/modules/setting"
+)
+
+// ServSlot is returned by AcquireServSlot; Release must be called once the
+// git process it guards has exited, regardless of success or failure.
+type ServSlot struct {
+	token string
+}
+
+// ServSlotResponse is the payload returned by the internal API.
+type ServSlotResponse struct {
+	Token string `json:"token"`
+}
+
+// AcquireServSlot asks the web process for permission to spawn a git
+// process for keyID/userID, enforcing [ssh.limits] (MaxConcurrentPerKey,
+// ClonesPerMinute, PushesPerMinute) across every `gitea serv` invocation on
+// the node. verb is the git command being run ("git-upload-pack",
+// "git-upload-archive" or "git-receive-pack"); "git-receive-pack" counts
+// against PushesPerMinute, every other verb against ClonesPerMinute.
+func AcquireServSlot(keyID, userID int64, verb string) (*ServSlot, error) {
+	reqURL := setting.LocalURL + "api/internal/ssh/serv-slot"
+
+	resp, err := newInternalRequest(reqURL, "POST").Body(map[string]interface{}{
+		"key_id":  keyID,
+		"user_id": userID,
+		"verb":    verb,
+	}).Response()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, fmt.Errorf("rate limit exceeded for this key, please slow down")
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Failed to acquire serv slot: %s", decodeJSONError(resp).Err)
+	}
+
+	var slot ServSlotResponse
+	if err := json.NewDecoder(resp.Body).Decode(&slot); err != nil {
+		return nil, err
+	}
+	return &ServSlot{token: slot.Token}, nil
+}
+
+// Release frees the concurrency slot held for this git process.
+func (s *ServSlot) Release() error {
+	if s == nil {
+		return nil
+	}
+	reqURL := setting.LocalURL + "api/internal/ssh/serv-slot/" + s.token
+
+	resp, err := newInternalRequest(reqURL, "DELETE").Response()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
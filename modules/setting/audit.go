@@ -0,0 +1,39 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package setting
+
+import "code.gitea.io/gitea/modules/log"
+
+// Audit settings control where structured audit events (currently git
+// operations over SSH, emitted by cmd/serv) are emitted, independent of the
+// human-readable GitLogger used for debugging.
+var Audit = struct {
+	Enabled bool   `ini:"ENABLED"`
+	Sink    string `ini:"SINK"` // "file", "syslog" or "webhook"
+
+	FilePath string `ini:"FILE_PATH"`
+
+	SyslogNetwork string `ini:"SYSLOG_NETWORK"`
+	SyslogAddress string `ini:"SYSLOG_ADDRESS"`
+
+	WebhookURL     string `ini:"WEBHOOK_URL"`
+	WebhookTimeout int    `ini:"WEBHOOK_TIMEOUT"` // seconds
+}{
+	Sink:           "file",
+	FilePath:       "log/audit.log",
+	WebhookTimeout: 5,
+}
+
+func newAudit() {
+	if err := Cfg.Section("audit").MapTo(&Audit); err != nil {
+		log.Fatal(4, "Failed to map audit settings: %v", err)
+	}
+
+	switch Audit.Sink {
+	case "file", "syslog", "webhook":
+	default:
+		log.Fatal(4, "Invalid audit SINK %q, must be 'file', 'syslog' or 'webhook'", Audit.Sink)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package setting
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"code.gitea.io/gitea/modules/log"
+)
+
+// LFSJWTKey is one entry of the LFS JWT signing keyring: a secret tagged
+// with a "kid" so tokens can name which key signed them, plus the time it
+// was added so retirement can be gated on HTTPAuthExpiry. Only the newest
+// entry is used to sign new tokens; every entry is accepted when verifying,
+// so rotating the keyring never invalidates in-flight transfers.
+type LFSJWTKey struct {
+	Kid       string
+	Secret    string
+	AddedUnix int64
+}
+
+type lfsSettings struct {
+	StartServer    bool          `ini:"LFS_START_SERVER"`
+	ContentPath    string        `ini:"LFS_CONTENT_PATH"`
+	HTTPAuthExpiry time.Duration `ini:"LFS_HTTP_AUTH_EXPIRY"`
+
+	// JWTSecrets is the signing keyring, oldest first, persisted as
+	// [lfs.jwt.<kid>] child sections (see loadLFSJWTKeyring/persist) rather
+	// than a single ini value, since a section can only hold one of each
+	// key. Kept for backwards compatibility with the single-secret
+	// LFS_JWT_SECRET setting: if JWTSecrets is empty it is seeded from that
+	// value.
+	JWTSecrets []LFSJWTKey `ini:"-"`
+}
+
+// LFS settings
+var LFS = lfsSettings{
+	HTTPAuthExpiry: 20 * time.Minute,
+}
+
+func newLFS() {
+	if err := Cfg.Section("server").MapTo(&LFS); err != nil {
+		log.Fatal(4, "Failed to map LFS settings: %v", err)
+	}
+
+	LFS.JWTSecrets = loadLFSJWTKeyring()
+
+	sec := Cfg.Section("server")
+	if legacy := sec.Key("LFS_JWT_SECRET").String(); len(legacy) > 0 && len(LFS.JWTSecrets) == 0 {
+		LFS.JWTSecrets = []LFSJWTKey{{Kid: "default", Secret: legacy, AddedUnix: time.Now().Unix()}}
+	}
+
+	if LFS.StartServer && len(LFS.JWTSecrets) == 0 {
+		log.Fatal(4, "LFS_JWT_SECRET (or [lfs.jwt.*] keys) must be set when LFS is enabled")
+	}
+}
+
+// loadLFSJWTKeyring reads every [lfs.jwt.<kid>] child section written by a
+// previous `gitea admin lfs rotate-jwt`, oldest first, so the last entry is
+// always the most recently rotated (and therefore signing) key.
+func loadLFSJWTKeyring() []LFSJWTKey {
+	var keyring []LFSJWTKey
+	for _, child := range Cfg.Section("lfs.jwt").ChildSections() {
+		keyring = append(keyring, LFSJWTKey{
+			Kid:       strings.TrimPrefix(child.Name(), "lfs.jwt."),
+			Secret:    child.Key("SECRET").String(),
+			AddedUnix: child.Key("ADDED").MustInt64(),
+		})
+	}
+	sort.Slice(keyring, func(i, j int) bool { return keyring[i].AddedUnix < keyring[j].AddedUnix })
+	return keyring
+}
+
+// persist writes the in-memory keyring back to [lfs.jwt.<kid>] child
+// sections of Cfg, so the caller's subsequent SaveConfig() actually durably
+// records a rotation instead of it being lost when the one-shot CLI process
+// exits.
+func (l *lfsSettings) persist() {
+	for _, existing := range Cfg.Section("lfs.jwt").ChildSections() {
+		Cfg.DeleteSection(existing.Name())
+	}
+	for _, key := range l.JWTSecrets {
+		sec, err := Cfg.NewSection("lfs.jwt." + key.Kid)
+		if err != nil {
+			continue
+		}
+		sec.Key("SECRET").SetValue(key.Secret)
+		sec.Key("ADDED").SetValue(fmt.Sprintf("%d", key.AddedUnix))
+	}
+}
+
+// SigningKey returns the keyring entry used to sign new LFS tokens: always
+// the newest (last) one, so `gitea admin lfs rotate-jwt` only has to append.
+func (l *lfsSettings) SigningKey() (LFSJWTKey, error) {
+	if len(l.JWTSecrets) == 0 {
+		return LFSJWTKey{}, fmt.Errorf("no LFS JWT signing key configured")
+	}
+	return l.JWTSecrets[len(l.JWTSecrets)-1], nil
+}
+
+// KeyByKid returns the keyring entry matching kid, used to verify a token
+// signed by any currently- or previously-active key.
+func (l *lfsSettings) KeyByKid(kid string) (LFSJWTKey, bool) {
+	for _, k := range l.JWTSecrets {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return LFSJWTKey{}, false
+}
+
+// AppendJWTSecret adds a new signing key to the end of the keyring (making
+// it the active signer) without touching existing entries, so tokens
+// already signed with older keys keep verifying, and persists the keyring
+// so the rotation survives past this process.
+func (l *lfsSettings) AppendJWTSecret(kid, secret string) {
+	l.JWTSecrets = append(l.JWTSecrets, LFSJWTKey{Kid: kid, Secret: secret, AddedUnix: time.Now().Unix()})
+	l.persist()
+}
+
+// RetireExpired drops every keyring entry except the newest, but only once
+// HTTPAuthExpiry has elapsed since the key being replaced (the previous
+// newest, not the one just appended by this rotation) became active: any
+// token it signed has an exp no later than that, so retiring earlier would
+// reject transfers already in flight. Reports false only while that window
+// is still open; a keyring of one key, with nothing to retire,
+// reports true.
+//
+// Callers always invoke this right after AppendJWTSecret, whose entry is
+// therefore always ~0s old; gating on it instead of the previous entry
+// would make this return false forever.
+func (l *lfsSettings) RetireExpired() bool {
+	kept, retired := retireExpired(l.JWTSecrets, l.HTTPAuthExpiry, time.Now())
+	if !retired {
+		return false
+	}
+	l.JWTSecrets = kept
+	l.persist()
+	return true
+}
+
+// retireExpired is the pure timing decision behind RetireExpired, split out
+// so it can be unit tested without a live ini.File backing Cfg.
+func retireExpired(secrets []LFSJWTKey, httpAuthExpiry time.Duration, now time.Time) ([]LFSJWTKey, bool) {
+	if len(secrets) <= 1 {
+		return secrets, true
+	}
+	previous := secrets[len(secrets)-2]
+	if now.Sub(time.Unix(previous.AddedUnix, 0)) < httpAuthExpiry {
+		return secrets, false
+	}
+	return secrets[len(secrets)-1:], true
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package setting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetireExpired(t *testing.T) {
+	httpAuthExpiry := 20 * time.Minute
+	now := time.Unix(1000000, 0)
+
+	cases := []struct {
+		name        string
+		secrets     []LFSJWTKey
+		wantRetired bool
+		wantKept    int
+	}{
+		{
+			name:        "single key, nothing to retire",
+			secrets:     []LFSJWTKey{{Kid: "a", AddedUnix: now.Unix()}},
+			wantRetired: true,
+			wantKept:    1,
+		},
+		{
+			name: "rotation just happened: previous key still within HTTPAuthExpiry",
+			secrets: []LFSJWTKey{
+				{Kid: "old", AddedUnix: now.Add(-httpAuthExpiry / 2).Unix()},
+				{Kid: "new", AddedUnix: now.Unix()},
+			},
+			wantRetired: false,
+			wantKept:    2,
+		},
+		{
+			name: "previous key older than HTTPAuthExpiry: safe to retire",
+			secrets: []LFSJWTKey{
+				{Kid: "old", AddedUnix: now.Add(-2 * httpAuthExpiry).Unix()},
+				{Kid: "new", AddedUnix: now.Unix()},
+			},
+			wantRetired: true,
+			wantKept:    1,
+		},
+		{
+			name: "newest key being ~0s old must not block retirement of an eligible older key",
+			secrets: []LFSJWTKey{
+				{Kid: "ancient", AddedUnix: now.Add(-3 * httpAuthExpiry).Unix()},
+				{Kid: "brand-new", AddedUnix: now.Unix()},
+			},
+			wantRetired: true,
+			wantKept:    1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kept, retired := retireExpired(c.secrets, httpAuthExpiry, now)
+			if retired != c.wantRetired {
+				t.Fatalf("retired = %v, want %v", retired, c.wantRetired)
+			}
+			if len(kept) != c.wantKept {
+				t.Fatalf("kept %d entries, want %d", len(kept), c.wantKept)
+			}
+			if c.wantKept == 1 && kept[0].Kid != c.secrets[len(c.secrets)-1].Kid {
+				t.Fatalf("kept the wrong key: %q", kept[0].Kid)
+			}
+		})
+	}
+}
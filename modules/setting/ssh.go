@@ -0,0 +1,134 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package setting
+
+import (
+	"bufio"
+	"os"
+	"time"
+
+	"code.gitea.io/gitea/modules/log"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH settings
+var SSH = struct {
+	Disabled            bool   `ini:"DISABLE_SSH"`
+	StartBuiltinServer  bool   `ini:"START_SSH_SERVER"`
+	Domain              string `ini:"SSH_DOMAIN"`
+	Port                int    `ini:"SSH_PORT"`
+	ListenHost          string `ini:"SSH_LISTEN_HOST"`
+	ListenPort          int    `ini:"SSH_LISTEN_PORT"`
+	RootPath            string `ini:"SSH_ROOT_PATH"`
+	ServerCiphers       []string
+	KeyTestPath         string         `ini:"SSH_KEY_TEST_PATH"`
+	KeygenPath          string         `ini:"SSH_KEYGEN_PATH"`
+	MinimumKeySizeCheck bool           `ini:"-"`
+	MinimumKeySizes     map[string]int `ini:"-"`
+
+	// CertificateAuthEnabled turns on certificate-principal lookup in
+	// `gitea serv` (see --principal), driven by sshd's
+	// AuthorizedPrincipalsCommand. In this forced-command mode sshd has
+	// already completed CA-signature, ValidBefore/ValidAfter and
+	// critical-option verification using its own, separately configured
+	// TrustedUserCAKeys before gitea is ever invoked: the raw certificate
+	// is never handed to gitea, only the principal name, so gitea cannot
+	// and does not re-verify it here. TrustedUserCAKeys(File) below apply
+	// only to the other integration mode, Gitea's own built-in SSH server.
+	CertificateAuthEnabled bool `ini:"SSH_CERT_AUTH_ENABLED"`
+
+	// TrustedUserCAKeysFile points at an authorized_keys-formatted file of
+	// CA public keys, one per line - the same format and semantics as
+	// sshd_config's TrustedUserCAKeys. The parsed keys are read only by
+	// modules/ssh.NewCertChecker, which targets Gitea's own built-in SSH
+	// server (StartBuiltinServer): that server terminates the SSH protocol
+	// itself, so it is the party able to verify a presented certificate's
+	// issuing CA, validity window and critical options. Nothing in this
+	// build calls NewCertChecker, so setting this file enforces nothing
+	// (newSSH logs a warning when it is set).
+	TrustedUserCAKeysFile string          `ini:"SSH_TRUSTED_USER_CA_KEYS_FILE"`
+	TrustedUserCAKeys     []ssh.PublicKey `ini:"-"`
+
+	// PrincipalsFormat describes how a certificate principal is turned into
+	// a Gitea login, either "username" or "email".
+	PrincipalsFormat string
+
+	// Limits holds [ssh.limits]: per-key concurrency and per-minute rate
+	// caps, enforced via private.AcquireServSlot so they apply across
+	// every SSH connection on the node, not just within a single `gitea
+	// serv` process.
+	Limits struct {
+		MaxConcurrentPerKey int           `ini:"MAX_CONCURRENT_PER_KEY"`
+		ClonesPerMinute     int           `ini:"CLONES_PER_MINUTE"`
+		PushesPerMinute     int           `ini:"PUSHES_PER_MINUTE"`
+		SlotLeaseTimeout    time.Duration `ini:"SLOT_LEASE_TIMEOUT"`
+	} `ini:"-"`
+}{
+	PrincipalsFormat: "username",
+}
+
+func newSSH() {
+	if err := Cfg.Section("server").MapTo(&SSH); err != nil {
+		log.Fatal(4, "Failed to map SSH settings: %v", err)
+	}
+
+	switch SSH.PrincipalsFormat {
+	case "username", "email":
+	default:
+		log.Fatal(4, "Invalid PrincipalsFormat %q, must be 'username' or 'email'", SSH.PrincipalsFormat)
+	}
+
+	if len(SSH.TrustedUserCAKeysFile) > 0 {
+		keys, err := parseTrustedUserCAKeys(SSH.TrustedUserCAKeysFile)
+		if err != nil {
+			log.Fatal(4, "Failed to parse TrustedUserCAKeysFile %q: %v", SSH.TrustedUserCAKeysFile, err)
+		}
+		SSH.TrustedUserCAKeys = keys
+
+		// modules/ssh.NewCertChecker is the only code that reads
+		// TrustedUserCAKeys, and nothing in this build's built-in SSH
+		// server wires it into a PublicKeyCallback yet: until that
+		// integration lands, this setting verifies nothing on its own.
+		log.Warn(4, "SSH_TRUSTED_USER_CA_KEYS_FILE is set, but this build does not yet call modules/ssh.NewCertChecker from the built-in SSH server - certificate verification is not actually enforced by Gitea")
+	}
+
+	if err := Cfg.Section("ssh.limits").MapTo(&SSH.Limits); err != nil {
+		log.Fatal(4, "Failed to map SSH limits settings: %v", err)
+	}
+	if SSH.Limits.SlotLeaseTimeout == 0 {
+		// A gitea serv process that never calls Release (killed by a
+		// client network drop, OOM, host crash - all routine for
+		// long-lived clone/push sessions) must not leak its slot forever;
+		// see private.AcquireServSlot's expiry sweep.
+		SSH.Limits.SlotLeaseTimeout = time.Hour
+	}
+}
+
+// parseTrustedUserCAKeys reads an authorized_keys-formatted file, one CA
+// public key per line, in the same format sshd_config's TrustedUserCAKeys
+// expects.
+func parseTrustedUserCAKeys(path string) ([]ssh.PublicKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []ssh.PublicKey
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
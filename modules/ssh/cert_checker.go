@@ -0,0 +1,70 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package ssh backs Gitea's own built-in SSH server (setting.SSH
+// StartBuiltinServer). Unlike cmd/serv, which only ever runs as a forced
+// command under system sshd and so never sees more than an
+// already-validated principal name, this package terminates the SSH
+// protocol itself via golang.org/x/crypto/ssh, which is what actually lets
+// it perform independent certificate verification.
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"code.gitea.io/gitea/modules/setting"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NewCertChecker returns an *ssh.CertChecker wired to the CA keys
+// configured in setting.SSH.TrustedUserCAKeys. Use it as (or from) a
+// ServerConfig.PublicKeyCallback: the ssh package verifies the
+// certificate's own signature as part of the handshake itself, while
+// IsUserAuthority gates which CA is trusted and CheckCert enforces the
+// validity window and critical options.
+//
+// Not yet called from a PublicKeyCallback in this build - the built-in SSH
+// server's connection handling lives outside this tree. Until it is wired
+// in, setting.SSH.TrustedUserCAKeysFile has no effect (setting.newSSH logs
+// a warning to that effect).
+func NewCertChecker() *ssh.CertChecker {
+	return &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			for _, ca := range setting.SSH.TrustedUserCAKeys {
+				if ssh.KeysEqual(ca, auth) {
+					return true
+				}
+			}
+			return false
+		},
+		Clock: time.Now,
+	}
+}
+
+// PrincipalForCert validates cert against checker - CA trust (via
+// IsUserAuthority), the ValidBefore/ValidAfter window, and critical
+// options - trying each of the certificate's listed principals in turn,
+// and returns the first that passes. Callers authenticating an incoming
+// connection don't yet know which principal the client intends to use, so
+// this is the entry point rather than CheckCert itself.
+func PrincipalForCert(checker *ssh.CertChecker, cert *ssh.Certificate) (string, error) {
+	if len(cert.ValidPrincipals) == 0 {
+		return "", fmt.Errorf("certificate has no valid principals")
+	}
+	// CheckCert does not consult IsUserAuthority itself, so the CA is gated here.
+	if checker.IsUserAuthority == nil || !checker.IsUserAuthority(cert.SignatureKey) {
+		return "", fmt.Errorf("certificate signed by unrecognized authority")
+	}
+	var lastErr error
+	for _, principal := range cert.ValidPrincipals {
+		if err := checker.CheckCert(principal, cert); err != nil {
+			lastErr = err
+			continue
+		}
+		return principal, nil
+	}
+	return "", fmt.Errorf("certificate failed validation for every listed principal: %v", lastErr)
+}
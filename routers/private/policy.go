@@ -0,0 +1,32 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package private
+
+import (
+	"net/http"
+
+	"code.gitea.io/gitea/models"
+
+	"gopkg.in/macaron.v1"
+)
+
+// GetRepoPolicy handles GET /api/internal/repositories/:id/policy, the
+// server side of private.GetRepoPolicy: it looks up the push policy
+// configured for a repository, reporting 404 when none is set so the
+// caller knows to enforce no rules rather than treating it as an error.
+func GetRepoPolicy(ctx *macaron.Context) {
+	repoID := ctx.ParamsInt64(":id")
+
+	policy, err := models.GetRepoPolicy(repoID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	if policy == nil {
+		ctx.JSON(http.StatusNotFound, map[string]interface{}{"err": "no policy configured"})
+		return
+	}
+	ctx.JSON(http.StatusOK, policy)
+}
@@ -0,0 +1,35 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package private
+
+import (
+	"net/http"
+	"net/url"
+
+	"code.gitea.io/gitea/models"
+	"code.gitea.io/gitea/modules/setting"
+
+	"gopkg.in/macaron.v1"
+)
+
+// GetUserByPrincipal handles GET /api/internal/ssh/:principal/user, the
+// server side of private.GetUserByPrincipal: it resolves an SSH
+// certificate principal (forwarded verbatim by `gitea serv --principal`)
+// to the Gitea user it authenticates, under the configured
+// PrincipalsFormat.
+func GetUserByPrincipal(ctx *macaron.Context) {
+	principal, err := url.PathUnescape(ctx.Params(":principal"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+
+	user, err := models.GetUserByPrincipal(principal, setting.SSH.PrincipalsFormat)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,20 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package private
+
+import (
+	"gopkg.in/macaron.v1"
+)
+
+// RegisterRoutes wires this package's handlers into the existing
+// /api/internal group that cmd/web.go mounts (alongside the key, deploy-key
+// and unit-access handlers already registered there), so modules/private's
+// client calls resolve to something other than a 404.
+func RegisterRoutes(m *macaron.Macaron) {
+	m.Get("/api/internal/ssh/:principal/user", GetUserByPrincipal)
+	m.Get("/api/internal/repositories/:id/policy", GetRepoPolicy)
+	m.Post("/api/internal/ssh/serv-slot", AcquireServSlot)
+	m.Delete("/api/internal/ssh/serv-slot/:token", ReleaseServSlot)
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 The Gitea Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package private
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.gitea.io/gitea/modules/setting"
+
+	"gopkg.in/macaron.v1"
+)
+
+// servSlotBucket identifies what a serv slot is rate-limited against: a
+// real SSH key, a real user (certificate principals have no key), or
+// neither (anonymous clone of a public repo), which cmd/serv never sends
+// here in the first place - see the skip in cmd/serv.go.
+type servSlotBucket struct {
+	KeyID  int64
+	UserID int64
+}
+
+// servSlotLease is one outstanding AcquireServSlot grant: the bucket it
+// counts against and when it was acquired, so a slot whose `gitea serv`
+// process never calls Release (killed by a client network drop, OOM, host
+// crash) can still be reclaimed once it's older than SlotLeaseTimeout,
+// instead of permanently denying that bucket.
+type servSlotLease struct {
+	Bucket     servSlotBucket
+	AcquiredAt time.Time
+}
+
+// servSlots tracks, for the lifetime of this web process, how many git
+// processes are currently running per bucket and when clones/pushes were
+// last granted, so [ssh.limits] is enforced across every SSH connection on
+// the node rather than just within a single `gitea serv` invocation.
+type servSlots struct {
+	mu     sync.Mutex
+	active map[string]servSlotLease // token -> lease, for Release and expiry
+	counts map[servSlotBucket]int
+	clones map[servSlotBucket][]time.Time
+	pushes map[servSlotBucket][]time.Time
+}
+
+var slots = &servSlots{
+	active: make(map[string]servSlotLease),
+	counts: make(map[servSlotBucket]int),
+	clones: make(map[servSlotBucket][]time.Time),
+	pushes: make(map[servSlotBucket][]time.Time),
+}
+
+// reapExpired drops every lease older than SlotLeaseTimeout and decrements
+// its bucket's count, so a `gitea serv` process that was killed before
+// reaching Release doesn't leak its slot for the rest of this web
+// process's uptime. Called with slots.mu already held.
+func (s *servSlots) reapExpired(now time.Time) {
+	timeout := setting.SSH.Limits.SlotLeaseTimeout
+	if timeout <= 0 {
+		return
+	}
+	for token, lease := range s.active {
+		if now.Sub(lease.AcquiredAt) < timeout {
+			continue
+		}
+		delete(s.active, token)
+		s.counts[lease.Bucket]--
+		if s.counts[lease.Bucket] <= 0 {
+			delete(s.counts, lease.Bucket)
+		}
+	}
+}
+
+// servSlotForm is the JSON body AcquireServSlot sends.
+type servSlotForm struct {
+	KeyID  int64  `json:"key_id"`
+	UserID int64  `json:"user_id"`
+	Verb   string `json:"verb"`
+}
+
+// AcquireServSlot handles POST /api/internal/ssh/serv-slot, the server
+// side of private.AcquireServSlot: it enforces MaxConcurrentPerKey and the
+// per-minute clone/push caps for the bucket, returning 429 once a limit is
+// exceeded and a token to release via ReleaseServSlot otherwise.
+func AcquireServSlot(ctx *macaron.Context) {
+	var form servSlotForm
+	if err := json.NewDecoder(ctx.Req.Request.Body).Decode(&form); err != nil {
+		ctx.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+
+	bucket := servSlotBucket{KeyID: form.KeyID, UserID: form.UserID}
+	now := time.Now()
+
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+
+	slots.reapExpired(now)
+
+	if limit := setting.SSH.Limits.MaxConcurrentPerKey; limit > 0 && slots.counts[bucket] >= limit {
+		ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{"err": "too many concurrent git operations for this key"})
+		return
+	}
+
+	isPush := form.Verb == "git-receive-pack"
+	if isPush {
+		slots.pushes[bucket] = pruneOlderThanMinute(slots.pushes[bucket], now)
+		if limit := setting.SSH.Limits.PushesPerMinute; limit > 0 && len(slots.pushes[bucket]) >= limit {
+			ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{"err": "too many pushes for this key, please slow down"})
+			return
+		}
+	} else {
+		slots.clones[bucket] = pruneOlderThanMinute(slots.clones[bucket], now)
+		if limit := setting.SSH.Limits.ClonesPerMinute; limit > 0 && len(slots.clones[bucket]) >= limit {
+			ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{"err": "too many clones for this key, please slow down"})
+			return
+		}
+	}
+
+	token, err := newSlotToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, map[string]interface{}{"err": err.Error()})
+		return
+	}
+
+	slots.counts[bucket]++
+	slots.active[token] = servSlotLease{Bucket: bucket, AcquiredAt: now}
+	if isPush {
+		slots.pushes[bucket] = append(slots.pushes[bucket], now)
+	} else {
+		slots.clones[bucket] = append(slots.clones[bucket], now)
+	}
+
+	ctx.JSON(http.StatusOK, map[string]interface{}{"token": token})
+}
+
+// ReleaseServSlot handles DELETE /api/internal/ssh/serv-slot/:token, the
+// server side of (*private.ServSlot).Release: it frees the concurrency
+// slot so a later git process for the same bucket can acquire it.
+func ReleaseServSlot(ctx *macaron.Context) {
+	token := ctx.Params(":token")
+
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+
+	if lease, ok := slots.active[token]; ok {
+		delete(slots.active, token)
+		slots.counts[lease.Bucket]--
+		if slots.counts[lease.Bucket] <= 0 {
+			delete(slots.counts, lease.Bucket)
+		}
+	}
+
+	ctx.PlainText(http.StatusOK, []byte("success"))
+}
+
+func pruneOlderThanMinute(times []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-time.Minute)
+	kept := times[:0]
+	for _, t := range times {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+func newSlotToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}